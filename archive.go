@@ -0,0 +1,269 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// archiveFormat selects how archiveAndCleanup packages the merged output and
+// source files once a run completes successfully.
+type archiveFormat string
+
+const (
+	archiveFormatTarGz archiveFormat = "tar.gz"
+	archiveFormatZip   archiveFormat = "zip"
+	archiveFormatDir   archiveFormat = "dir"
+)
+
+// parseArchiveFormat validates a -archfmt flag value.
+func parseArchiveFormat(s string) (archiveFormat, error) {
+	switch archiveFormat(s) {
+	case archiveFormatTarGz, archiveFormatZip, archiveFormatDir:
+		return archiveFormat(s), nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q (want tar.gz, zip, or dir)", s)
+	}
+}
+
+// archiveAndCleanup archives the merged file and every source file in
+// datinDir according to format, then removes the originals. Source files are
+// only removed once the archive has been fully written and closed, so a
+// failure partway through never leaves the input directory empty-handed. It
+// returns the timestamp used to name the archive, so callers can seal a
+// manifest alongside it under a matching name.
+func archiveAndCleanup(archDir, mergedFilePath, datinDir string, format archiveFormat) (string, error) {
+	ts := time.Now().Format("20060102_150405")
+	switch format {
+	case archiveFormatTarGz:
+		return ts, archiveTarGz(archDir, mergedFilePath, datinDir, ts)
+	case archiveFormatZip:
+		return ts, archiveZipFile(archDir, mergedFilePath, datinDir, ts)
+	case archiveFormatDir:
+		return ts, archiveToDir(archDir, mergedFilePath, datinDir, ts)
+	default:
+		return "", fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// archiveInputs returns the merged file plus every regular file in datinDir,
+// i.e. everything that should end up in the archive.
+func archiveInputs(mergedFilePath, datinDir string) ([]string, error) {
+	entries, err := os.ReadDir(datinDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read datin directory %s for archiving: %w", datinDir, err)
+	}
+
+	paths := []string{mergedFilePath}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			paths = append(paths, filepath.Join(datinDir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// archiveTarGz streams the merged file and every source file into a single
+// timestamped archive_YYYYMMDD_HHMMSS.tar.gz under archDir.
+func archiveTarGz(archDir, mergedFilePath, datinDir, ts string) error {
+	if err := os.MkdirAll(archDir, 0755); err != nil {
+		return fmt.Errorf("could not create archive directory %s: %w", archDir, err)
+	}
+
+	paths, err := archiveInputs(mergedFilePath, datinDir)
+	if err != nil {
+		return err
+	}
+
+	archivePath := filepath.Join(archDir, fmt.Sprintf("archive_%s.tar.gz", ts))
+	slog.Info("archiving files", "count", len(paths), "archive", archivePath)
+
+	archF, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("could not create archive file %s: %w", archivePath, err)
+	}
+
+	gw := gzip.NewWriter(archF)
+	tw := tar.NewWriter(gw)
+
+	for _, path := range paths {
+		if err := addFileToTar(tw, path); err != nil {
+			tw.Close()
+			gw.Close()
+			archF.Close()
+			return fmt.Errorf("failed to add %s to archive: %w", path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		gw.Close()
+		archF.Close()
+		return fmt.Errorf("failed to finalize tar writer: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		archF.Close()
+		return fmt.Errorf("failed to finalize gzip writer: %w", err)
+	}
+	if err := archF.Sync(); err != nil {
+		archF.Close()
+		return fmt.Errorf("failed to fsync archive file %s: %w", archivePath, err)
+	}
+	if err := archF.Close(); err != nil {
+		return fmt.Errorf("failed to close archive file %s: %w", archivePath, err)
+	}
+
+	return removeArchivedFiles(paths)
+}
+
+// addFileToTar writes path's header and contents to tw.
+func addFileToTar(tw *tar.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:     filepath.Base(path),
+		Mode:     0644,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// archiveZipFile streams the merged file and every source file into a single
+// timestamped archive_YYYYMMDD_HHMMSS.zip under archDir.
+func archiveZipFile(archDir, mergedFilePath, datinDir, ts string) error {
+	if err := os.MkdirAll(archDir, 0755); err != nil {
+		return fmt.Errorf("could not create archive directory %s: %w", archDir, err)
+	}
+
+	paths, err := archiveInputs(mergedFilePath, datinDir)
+	if err != nil {
+		return err
+	}
+
+	archivePath := filepath.Join(archDir, fmt.Sprintf("archive_%s.zip", ts))
+	slog.Info("archiving files", "count", len(paths), "archive", archivePath)
+
+	archF, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("could not create archive file %s: %w", archivePath, err)
+	}
+
+	zw := zip.NewWriter(archF)
+
+	for _, path := range paths {
+		if err := addFileToZip(zw, path); err != nil {
+			zw.Close()
+			archF.Close()
+			return fmt.Errorf("failed to add %s to archive: %w", path, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		archF.Close()
+		return fmt.Errorf("failed to finalize zip writer: %w", err)
+	}
+	if err := archF.Sync(); err != nil {
+		archF.Close()
+		return fmt.Errorf("failed to fsync archive file %s: %w", archivePath, err)
+	}
+	if err := archF.Close(); err != nil {
+		return fmt.Errorf("failed to close archive file %s: %w", archivePath, err)
+	}
+
+	return removeArchivedFiles(paths)
+}
+
+// addFileToZip writes path's header and contents to zw.
+func addFileToZip(zw *zip.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(path)
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// removeArchivedFiles deletes the merged file and source files once they have
+// been safely written into an archive.
+func removeArchivedFiles(paths []string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			slog.Warn("failed to remove archived file", "file", path, "err", err)
+		}
+	}
+	return nil
+}
+
+// archiveToDir preserves the original behavior: move the merged file and
+// every source file into a timestamped subdirectory of archDir.
+func archiveToDir(archDir, mergedFilePath, datinDir, ts string) error {
+	archiveSubDir := filepath.Join(archDir, fmt.Sprintf("archive_%s", ts))
+	if err := os.MkdirAll(archiveSubDir, 0755); err != nil {
+		return fmt.Errorf("could not create archive subdirectory %s: %w", archiveSubDir, err)
+	}
+	slog.Info("created archive directory", "dir", archiveSubDir)
+
+	mergedFileName := filepath.Base(mergedFilePath)
+	newMergedPath := filepath.Join(archiveSubDir, mergedFileName)
+	slog.Info("archiving merged file", "dest", newMergedPath)
+	if err := os.Rename(mergedFilePath, newMergedPath); err != nil {
+		return fmt.Errorf("failed to archive merged file: %w", err)
+	}
+
+	slog.Info("archiving source files")
+	files, err := os.ReadDir(datinDir)
+	if err != nil {
+		return fmt.Errorf("could not read datin directory %s for archiving: %w", datinDir, err)
+	}
+
+	for _, file := range files {
+		if !file.IsDir() {
+			oldPath := filepath.Join(datinDir, file.Name())
+			newPath := filepath.Join(archiveSubDir, file.Name())
+			if err := os.Rename(oldPath, newPath); err != nil {
+				slog.Warn("failed to archive source file", "file", oldPath, "err", err)
+			}
+		}
+	}
+
+	slog.Info("archiving and cleanup complete")
+	return nil
+}
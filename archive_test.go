@@ -0,0 +1,90 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddFileToTarRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "aapl.csv")
+	want := "date,close\n2024-01-01,1\n"
+	if err := os.WriteFile(path, []byte(want), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := addFileToTar(tw, path); err != nil {
+		t.Fatalf("addFileToTar: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tw.Close: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("tr.Next: %v", err)
+	}
+	if header.Name != "aapl.csv" {
+		t.Errorf("header.Name = %q, want %q", header.Name, "aapl.csv")
+	}
+	got, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("io.ReadAll: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("expected a single entry, got another or err=%v", err)
+	}
+}
+
+func TestAddFileToZipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "msft.csv")
+	want := "date,close\n2024-01-01,2\n"
+	if err := os.WriteFile(path, []byte(want), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := addFileToZip(zw, path); err != nil {
+		t.Fatalf("addFileToZip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zw.Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader: %v", err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("got %d zip entries, want 1", len(zr.File))
+	}
+	entry := zr.File[0]
+	if entry.Name != "msft.csv" {
+		t.Errorf("entry.Name = %q, want %q", entry.Name, "msft.csv")
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		t.Fatalf("entry.Open: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("io.ReadAll: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("contents = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import "errors"
+
+// Sentinel errors for per-file merge failures. Wrap these with fmt.Errorf's
+// %w verb so callers can categorize a failure with errors.Is without parsing
+// log text.
+var (
+	ErrOpenFailed = errors.New("could not open file")
+	ErrBadCSV     = errors.New("invalid CSV data")
+	ErrEmptyFile  = errors.New("empty or header-only file")
+)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// multiHandler fans a slog.Record out to several handlers, so a single
+// logger call can write human-readable text to stdout and structured JSON
+// to a log file at the same time.
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+func newMultiHandler(handlers ...slog.Handler) *multiHandler {
+	return &multiHandler{handlers: handlers}
+}
+
+func (m *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m.handlers {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m.handlers {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		next[i] = h.WithAttrs(attrs)
+	}
+	return newMultiHandler(next...)
+}
+
+func (m *multiHandler) WithGroup(name string) slog.Handler {
+	next := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		next[i] = h.WithGroup(name)
+	}
+	return newMultiHandler(next...)
+}
+
+// setupLogger configures the default slog.Logger to write human-readable
+// text to stdout and structured JSON lines to a timestamped file in
+// logDir, so log aggregation can parse fields like file/ticker/rows/err
+// without scraping message strings.
+func setupLogger(logDir string) error {
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf("could not create log directory %s: %w", logDir, err)
+	}
+
+	logFile := filepath.Join(logDir, fmt.Sprintf("merge_process_%s.log", time.Now().Format("20060102_150405")))
+	f, err := os.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return fmt.Errorf("could not open log file %s: %w", logFile, err)
+	}
+
+	handler := newMultiHandler(
+		slog.NewTextHandler(os.Stdout, nil),
+		slog.NewJSONHandler(f, nil),
+	)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
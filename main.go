@@ -1,14 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"time"
 )
 
@@ -18,6 +18,14 @@ func main() {
 	datoutDir := flag.String("datout", "", "Output directory for the merged file (required)")
 	datlogDir := flag.String("datlog", "", "Directory for log files (required)")
 	archDir := flag.String("arch", "", "Directory to archive source and merged files (required)")
+	archFmt := flag.String("archfmt", string(archiveFormatTarGz), "Archive format for source and merged files: tar.gz, zip, or dir")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of worker goroutines for parsing CSV files")
+	ordered := flag.Bool("ordered", true, "Write merged rows in deterministic ticker order instead of arrival order")
+	schemaFlag := flag.String("schema", string(schemaModeStrict), "Header reconciliation mode across input files: strict, union, or intersect")
+	nullSentinel := flag.String("null", "", "Value to fill missing cells with in union schema mode")
+	ignoreWarnings := flag.Bool("ignore-warnings", false, "Exit 0 even if some input files were skipped with warnings")
+	dedupWindow := flag.Int("dedup-window", 5, "Number of past archived manifests to check for already-merged files")
+	dryRun := flag.Bool("dry-run", false, "Write the manifest and log what would be merged, without touching source files or writing output")
 	flag.Parse()
 
 	// Validate that all required arguments are provided.
@@ -27,163 +35,171 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Set up structured logging to a file.
-	// This function is the key to creating the log file.
+	format, err := parseArchiveFormat(*archFmt)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	schema, err := parseSchemaMode(*schemaFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Set up structured logging: human-readable text on stdout, JSON in the
+	// log file.
 	if err := setupLogger(*datlogDir); err != nil {
 		// If logger fails, we can't log, so we panic.
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
 
-	log.Println("Process started.")
-	log.Printf("Input Directory: %s", *datinDir)
-	log.Printf("Output Directory: %s", *datoutDir)
-	log.Printf("Log Directory: %s", *datlogDir)
-	log.Printf("Archive Directory: %s", *archDir)
+	slog.Info("process started",
+		"datin", *datinDir,
+		"datout", *datoutDir,
+		"datlog", *datlogDir,
+		"arch", *archDir,
+		"workers", *workers,
+		"dryRun", *dryRun,
+	)
 
 	// Core logic is wrapped to handle errors gracefully.
-	outputFilePath, err := processFiles(*datinDir, *datoutDir)
+	outputFilePath, report, manifest, err := processFiles(*datinDir, *datoutDir, *archDir, *workers, *ordered, schema, *nullSentinel, *dedupWindow, *dryRun)
 	if err != nil {
-		log.Fatalf("FATAL: File processing failed: %v", err)
+		slog.Error("file processing failed", "err", err)
+		os.Exit(1)
 	}
 
-	// On success, run the archiving and cleanup process.
-	if err := archiveAndCleanup(*archDir, outputFilePath, *datinDir); err != nil {
-		log.Fatalf("FATAL: Archiving and cleanup failed: %v", err)
+	if *dryRun {
+		slog.Info("dry run complete, no output written")
+		return
 	}
 
-	log.Println("Process completed successfully.")
-}
-
-// setupLogger configures the log package to write to a timestamped file in the log directory.
-func setupLogger(logDir string) error {
-	// Create the log directory if it doesn't exist.
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("could not create log directory %s: %w", logDir, err)
+	// On success, run the archiving and cleanup process, then seal the
+	// manifest alongside the archive so future runs can dedup against it.
+	ts, err := archiveAndCleanup(*archDir, outputFilePath, *datinDir, format)
+	if err != nil {
+		slog.Error("archiving and cleanup failed", "err", err)
+		os.Exit(1)
 	}
 
-	// Create a unique, timestamped log file name.
-	logFile := filepath.Join(logDir, fmt.Sprintf("merge_process_%s.log", time.Now().Format("20060102_150405")))
-	f, err := os.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0664)
-	if err != nil {
-		return fmt.Errorf("could not open log file %s: %w", logFile, err)
+	sealed := sealManifest(manifest)
+	manifestPath := filepath.Join(*archDir, fmt.Sprintf("manifest_%s.json", ts))
+	if err := writeManifest(manifestPath, sealed); err != nil {
+		slog.Error("failed to archive manifest", "err", err)
+		os.Exit(1)
 	}
 
-	// Use io.MultiWriter to send log output to BOTH the console and the file.
-	mw := io.MultiWriter(os.Stdout, f)
-	log.SetOutput(mw)
-	return nil
+	slog.Info("process completed successfully",
+		"filesProcessed", report.FilesProcessed,
+		"filesSkipped", report.FilesSkipped,
+		"filesEmpty", report.FilesEmpty,
+	)
+
+	if len(report.Warnings) > 0 {
+		slog.Warn("merge completed with warnings", "count", len(report.Warnings), "err", report.Err())
+		if !*ignoreWarnings {
+			os.Exit(2)
+		}
+	}
 }
 
-// processFiles merges all CSVs from datinDir into a single file in datoutDir.
-func processFiles(datinDir, datoutDir string) (string, error) {
+// processFiles merges all CSVs from datinDir into a single file in datoutDir,
+// parsing files concurrently across workers goroutines while a single
+// writer goroutine streams rows to the output file. Headers are reconciled
+// into one merged schema (see schemaMode) before any rows are written, and a
+// live progress line reports files, rows, throughput, and ETA as the merge
+// runs.
+//
+// Before any of that, a manifest of every input file (path, size, mtime,
+// SHA-256, status) is written to datoutDir; files whose hash already
+// appears as merged in one of the dedupWindow most recent archived
+// manifests under archDir are skipped, making repeated runs over the same
+// dump idempotent. If dryRun is true, the manifest is written and the
+// intended merge is logged, but no output file is written and no source
+// files are touched.
+//
+// The returned MergeReport records per-file outcomes even when err is nil,
+// since individual files can be skipped without failing the run.
+func processFiles(datinDir, datoutDir, archDir string, workers int, ordered bool, schemaMode schemaMode, nullSentinel string, dedupWindow int, dryRun bool) (string, *MergeReport, *runManifest, error) {
 	if err := os.MkdirAll(datoutDir, 0755); err != nil {
-		return "", fmt.Errorf("could not create output directory %s: %w", datoutDir, err)
+		return "", nil, nil, fmt.Errorf("could not create output directory %s: %w", datoutDir, err)
 	}
 
-	dateStr := time.Now().Format("20060102")
-	outputFile := filepath.Join(datoutDir, fmt.Sprintf("extract_%s.csv", dateStr))
-	outF, err := os.Create(outputFile)
+	slog.Info("building manifest of input files")
+	manifest, err := buildManifest(datinDir)
 	if err != nil {
-		return "", fmt.Errorf("could not create output file %s: %w", outputFile, err)
+		return "", nil, nil, fmt.Errorf("error building manifest: %w", err)
+	}
+	if err := writeManifest(filepath.Join(datoutDir, "manifest.json"), manifest); err != nil {
+		return "", nil, nil, err
 	}
-	defer outF.Close()
-
-	writer := csv.NewWriter(outF)
-	defer writer.Flush()
-	headerWritten := false
-	filesProcessed := 0
-
-	log.Println("Starting to walk input directory...")
-	err = filepath.Walk(datinDir, func(path string, info os.FileInfo, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		if info.IsDir() {
-			return nil // Skip directories
-		}
-
-		if strings.HasSuffix(strings.ToLower(info.Name()), ".csv") {
-			// This is the line that logs each file as it's being processed.
-			log.Printf("Processing file: %s", info.Name())
-			ticker := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
 
-			inF, err := os.Open(path)
-			if err != nil {
-				log.Printf("WARNING: Could not open file %s, skipping. Error: %v", path, err)
-				return nil
-			}
-			defer inF.Close()
+	dedupHashes, err := loadMergedHashes(archDir, dedupWindow)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error loading prior manifests for dedup: %w", err)
+	}
 
-			reader := csv.NewReader(inF)
-			records, err := reader.ReadAll()
-			if err != nil {
-				log.Printf("WARNING: Could not read CSV data from %s, skipping. Error: %v", path, err)
-				return nil
-			}
+	slog.Info("reconciling input headers", "mode", schemaMode)
+	schema, err := buildSchema(datinDir, schemaMode, nullSentinel)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("error reconciling input headers: %w", err)
+	}
 
-			if len(records) < 2 {
-				log.Printf("INFO: Skipping empty or header-only file: %s", info.Name())
-				return nil
-			}
+	tracker := newManifestTracker(manifest)
 
-			if !headerWritten {
-				header := append(records[0], "tick_nm")
-				if err := writer.Write(header); err != nil {
-					return fmt.Errorf("failed to write header to output file: %w", err)
-				}
-				headerWritten = true
+	if dryRun {
+		wouldMerge, wouldSkipDup := 0, 0
+		for path := range schema.permutation {
+			if hash := tracker.hash(path); hash != "" && dedupHashes[hash] {
+				wouldSkipDup++
+				tracker.update(path, manifestStatusAlreadyMerged, 0)
+				continue
 			}
+			wouldMerge++
+		}
+		slog.Info("dry run: would merge", "wouldMerge", wouldMerge, "wouldSkipDuplicate", wouldSkipDup, "wouldSkipHeader", len(manifest.Files)-len(schema.permutation))
 
-			for i := 1; i < len(records); i++ {
-				row := append(records[i], ticker)
-				if err := writer.Write(row); err != nil {
-					return fmt.Errorf("failed to write row to output file: %w", err)
-				}
-			}
-			filesProcessed++
+		sealed := tracker.snapshot(manifest.GeneratedAt)
+		if err := writeManifest(filepath.Join(datoutDir, "manifest.json"), sealed); err != nil {
+			return "", nil, nil, err
 		}
-		return nil
-	})
+		return "", &MergeReport{}, sealed, nil
+	}
 
+	dateStr := time.Now().Format("20060102")
+	outputFile := filepath.Join(datoutDir, fmt.Sprintf("extract_%s.csv", dateStr))
+	outF, err := os.Create(outputFile)
 	if err != nil {
-		return "", fmt.Errorf("error during directory walk: %w", err)
+		return "", nil, nil, fmt.Errorf("could not create output file %s: %w", outputFile, err)
 	}
+	defer outF.Close()
 
-	log.Printf("Finished processing. Merged %d files into %s", filesProcessed, outputFile)
-	return outputFile, nil
-}
-
-// archiveAndCleanup moves the source files and the final merged file to a timestamped archive directory.
-func archiveAndCleanup(archDir, mergedFilePath, datinDir string) error {
-	archiveSubDir := filepath.Join(archDir, fmt.Sprintf("archive_%s", time.Now().Format("20060102_150405")))
-	if err := os.MkdirAll(archiveSubDir, 0755); err != nil {
-		return fmt.Errorf("could not create archive subdirectory %s: %w", archiveSubDir, err)
-	}
-	log.Printf("Created archive directory: %s", archiveSubDir)
+	writer := csv.NewWriter(outF)
+	defer writer.Flush()
 
-	mergedFileName := filepath.Base(mergedFilePath)
-	newMergedPath := filepath.Join(archiveSubDir, mergedFileName)
-	log.Printf("Archiving merged file to %s", newMergedPath)
-	if err := os.Rename(mergedFilePath, newMergedPath); err != nil {
-		return fmt.Errorf("failed to archive merged file: %w", err)
-	}
+	stats := &progressStats{}
+	done := make(chan struct{})
+	go reportProgress(context.Background(), stats, len(schema.permutation), done)
 
-	log.Println("Archiving source files...")
-	files, err := os.ReadDir(datinDir)
+	slog.Info("starting to walk input directory")
+	report, err := runPipeline(context.Background(), datinDir, writer, workers, ordered, schema, dedupHashes, tracker, stats)
+	close(done)
 	if err != nil {
-		return fmt.Errorf("could not read datin directory %s for archiving: %w", datinDir, err)
+		// err can originate from the directory walk, a parser worker, the
+		// writer goroutine, or context cancellation triggered by any of
+		// those, so it's reported generically rather than attributed to one
+		// stage.
+		return "", nil, nil, fmt.Errorf("merge pipeline failed: %w", err)
 	}
 
-	for _, file := range files {
-		if !file.IsDir() {
-			oldPath := filepath.Join(datinDir, file.Name())
-			newPath := filepath.Join(archiveSubDir, file.Name())
-			if err := os.Rename(oldPath, newPath); err != nil {
-				log.Printf("WARNING: Failed to archive source file %s: %v", oldPath, err)
-			}
-		}
+	sealed := tracker.snapshot(manifest.GeneratedAt)
+	if err := writeManifest(filepath.Join(datoutDir, "manifest.json"), sealed); err != nil {
+		return "", nil, nil, err
 	}
 
-	log.Println("Archiving and cleanup complete.")
-	return nil
+	slog.Info("finished processing", "filesProcessed", report.FilesProcessed, "filesSkipped", report.FilesSkipped, "filesEmpty", report.FilesEmpty, "output", outputFile)
+	return outputFile, report, sealed, nil
 }
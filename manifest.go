@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestStatus tracks an input file's progress through a merge run.
+type manifestStatus string
+
+const (
+	manifestStatusPending       manifestStatus = "pending"
+	manifestStatusMerged        manifestStatus = "merged"
+	manifestStatusSkipped       manifestStatus = "skipped"
+	manifestStatusArchived      manifestStatus = "archived"
+	manifestStatusAlreadyMerged manifestStatus = "already_merged"
+)
+
+// fileManifestEntry records enough about one input file to detect, in a
+// later run, whether the same content has already been merged.
+type fileManifestEntry struct {
+	Path    string         `json:"path"`
+	Size    int64          `json:"size"`
+	ModTime time.Time      `json:"mod_time"`
+	SHA256  string         `json:"sha256"`
+	Rows    int            `json:"rows"`
+	Status  manifestStatus `json:"status"`
+}
+
+// runManifest is the full record of one processFiles run. It's written to
+// manifest.json in datoutDir before processing starts (all entries
+// pending), and again once processing completes (entries merged/skipped).
+// A copy seals entries merged -> archived once archiveAndCleanup succeeds.
+type runManifest struct {
+	GeneratedAt time.Time           `json:"generated_at"`
+	Files       []fileManifestEntry `json:"files"`
+}
+
+// buildManifest hashes every CSV file under datinDir and records it as
+// pending, before any merging happens.
+func buildManifest(datinDir string) (*runManifest, error) {
+	paths, err := listCSVFiles(datinDir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &runManifest{GeneratedAt: time.Now(), Files: make([]fileManifestEntry, 0, len(paths))}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Warn("could not stat file for manifest, skipping", "file", path, "err", err)
+			continue
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			slog.Warn("could not hash file for manifest, skipping", "file", path, "err", err)
+			continue
+		}
+		m.Files = append(m.Files, fileManifestEntry{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			SHA256:  sum,
+			Status:  manifestStatusPending,
+		})
+	}
+	return m, nil
+}
+
+// hashFile returns the lowercase hex SHA-256 digest of a file's contents.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeManifest writes m as indented JSON to path.
+func writeManifest(path string, m *runManifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create manifest file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("could not write manifest file %s: %w", path, err)
+	}
+	return nil
+}
+
+// sealManifest returns a copy of m with every merged entry promoted to
+// archived, for writing alongside the finished archive.
+func sealManifest(m *runManifest) *runManifest {
+	sealed := &runManifest{GeneratedAt: m.GeneratedAt, Files: make([]fileManifestEntry, len(m.Files))}
+	for i, entry := range m.Files {
+		if entry.Status == manifestStatusMerged {
+			entry.Status = manifestStatusArchived
+		}
+		sealed.Files[i] = entry
+	}
+	return sealed
+}
+
+// loadMergedHashes scans archDir for the dedupWindow most recent archived
+// manifests and returns the set of content hashes already merged, so that a
+// second delivery of the same dump doesn't produce duplicate ticker rows.
+func loadMergedHashes(archDir string, dedupWindow int) (map[string]bool, error) {
+	merged := make(map[string]bool)
+	if dedupWindow <= 0 {
+		return merged, nil
+	}
+
+	entries, err := os.ReadDir(archDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return merged, nil
+		}
+		return nil, fmt.Errorf("could not read archive directory %s for dedup: %w", archDir, err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "manifest_") && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	if len(names) > dedupWindow {
+		names = names[:dedupWindow]
+	}
+
+	for _, name := range names {
+		path := filepath.Join(archDir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("could not read prior manifest, skipping", "file", path, "err", err)
+			continue
+		}
+		var m runManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			slog.Warn("could not parse prior manifest, skipping", "file", path, "err", err)
+			continue
+		}
+		for _, entry := range m.Files {
+			if entry.Status == manifestStatusMerged || entry.Status == manifestStatusArchived || entry.Status == manifestStatusAlreadyMerged {
+				merged[entry.SHA256] = true
+			}
+		}
+	}
+	return merged, nil
+}
+
+// manifestTracker lets concurrent workers update a shared runManifest's
+// per-file status and row count by path.
+type manifestTracker struct {
+	mu      sync.Mutex
+	entries []fileManifestEntry
+	index   map[string]int
+}
+
+func newManifestTracker(m *runManifest) *manifestTracker {
+	index := make(map[string]int, len(m.Files))
+	for i, entry := range m.Files {
+		index[entry.Path] = i
+	}
+	return &manifestTracker{entries: m.Files, index: index}
+}
+
+// hash returns the recorded SHA-256 for path, or "" if path isn't tracked.
+func (t *manifestTracker) hash(path string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i, ok := t.index[path]; ok {
+		return t.entries[i].SHA256
+	}
+	return ""
+}
+
+func (t *manifestTracker) update(path string, status manifestStatus, rows int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i, ok := t.index[path]; ok {
+		t.entries[i].Status = status
+		t.entries[i].Rows = rows
+	}
+}
+
+func (t *manifestTracker) snapshot(generatedAt time.Time) *runManifest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	files := make([]fileManifestEntry, len(t.entries))
+	copy(files, t.entries)
+	return &runManifest{GeneratedAt: generatedAt, Files: files}
+}
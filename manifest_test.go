@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildManifestHashesFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "close"}, {"2024-01-01", "1"}})
+
+	m, err := buildManifest(dir)
+	if err != nil {
+		t.Fatalf("buildManifest: %v", err)
+	}
+	if len(m.Files) != 1 {
+		t.Fatalf("got %d manifest entries, want 1", len(m.Files))
+	}
+	entry := m.Files[0]
+	if entry.Status != manifestStatusPending {
+		t.Errorf("status = %q, want %q", entry.Status, manifestStatusPending)
+	}
+	wantSum, err := hashFile(entry.Path)
+	if err != nil {
+		t.Fatalf("hashFile: %v", err)
+	}
+	if entry.SHA256 != wantSum {
+		t.Errorf("SHA256 = %q, want %q", entry.SHA256, wantSum)
+	}
+}
+
+// writeRunManifest simulates one completed processFiles run by writing a
+// sealed manifest for path/hash with the given status under archDir.
+func writeRunManifest(t *testing.T, archDir, ts, path, hash string, status manifestStatus) {
+	t.Helper()
+	m := &runManifest{
+		GeneratedAt: time.Time{},
+		Files: []fileManifestEntry{
+			{Path: path, SHA256: hash, Status: status},
+		},
+	}
+	if err := writeManifest(filepath.Join(archDir, fmt.Sprintf("manifest_%s.json", ts)), m); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+}
+
+// TestDedupSurvivesManifestWindowEviction reproduces the redelivery scenario
+// from the dedup bug report: a file merged once must still be recognized as
+// a duplicate many runs later, even with a dedup window of 1, because every
+// run that skips it carries the already-merged status forward into its own
+// manifest instead of downgrading it to "skipped".
+func TestDedupSurvivesManifestWindowEviction(t *testing.T) {
+	archDir := t.TempDir()
+	const path = "/datin/aapl.csv"
+	const hash = "deadbeef"
+	const dedupWindow = 1
+
+	// Run 1: file is merged for the first time.
+	writeRunManifest(t, archDir, "20260101_000001", path, hash, manifestStatusMerged)
+
+	// Run 2: the file is redelivered. loadMergedHashes must still find it
+	// merged from run 1's manifest (the only one in the window).
+	dedup, err := loadMergedHashes(archDir, dedupWindow)
+	if err != nil {
+		t.Fatalf("loadMergedHashes (run 2): %v", err)
+	}
+	if !dedup[hash] {
+		t.Fatal("run 2: hash not recognized as already merged")
+	}
+	// Simulate the skip: the tracker carries the already-merged status
+	// forward into run 2's own manifest.
+	writeRunManifest(t, archDir, "20260101_000002", path, hash, manifestStatusAlreadyMerged)
+
+	// Run 3: with dedupWindow=1, run 1's manifest has aged out and only run
+	// 2's manifest remains in view. Before the fix, run 2's manifest would
+	// have recorded "skipped" here, loadMergedHashes would not recognize
+	// that as evidence of a prior merge, and the file would be silently
+	// re-merged.
+	dedup, err = loadMergedHashes(archDir, dedupWindow)
+	if err != nil {
+		t.Fatalf("loadMergedHashes (run 3): %v", err)
+	}
+	if !dedup[hash] {
+		t.Fatal("run 3: hash forgotten after its originating manifest aged out of the dedup window")
+	}
+}
+
+func TestLoadMergedHashesIgnoresPlainSkipped(t *testing.T) {
+	archDir := t.TempDir()
+	const path = "/datin/msft.csv"
+	const hash = "badfile"
+
+	// A file skipped because it failed to parse is not a duplicate and
+	// must not be treated as already merged.
+	writeRunManifest(t, archDir, "20260101_000001", path, hash, manifestStatusSkipped)
+
+	dedup, err := loadMergedHashes(archDir, 5)
+	if err != nil {
+		t.Fatalf("loadMergedHashes: %v", err)
+	}
+	if dedup[hash] {
+		t.Fatal("a plain skipped entry must not be treated as already merged")
+	}
+}
+
+func TestManifestTrackerUpdateAndSnapshot(t *testing.T) {
+	m := &runManifest{Files: []fileManifestEntry{
+		{Path: "/datin/aapl.csv", SHA256: "abc", Status: manifestStatusPending},
+	}}
+	tracker := newManifestTracker(m)
+
+	if got := tracker.hash("/datin/aapl.csv"); got != "abc" {
+		t.Errorf("hash = %q, want %q", got, "abc")
+	}
+	if got := tracker.hash("/datin/missing.csv"); got != "" {
+		t.Errorf("hash for untracked path = %q, want \"\"", got)
+	}
+
+	tracker.update("/datin/aapl.csv", manifestStatusMerged, 42)
+	snap := tracker.snapshot(time.Now())
+	if snap.Files[0].Status != manifestStatusMerged || snap.Files[0].Rows != 42 {
+		t.Errorf("snapshot entry = %+v, want status=merged rows=42", snap.Files[0])
+	}
+}
+
+func TestSealManifestPromotesMergedToArchived(t *testing.T) {
+	m := &runManifest{Files: []fileManifestEntry{
+		{Path: "a", Status: manifestStatusMerged},
+		{Path: "b", Status: manifestStatusAlreadyMerged},
+		{Path: "c", Status: manifestStatusSkipped},
+	}}
+	sealed := sealManifest(m)
+	want := []manifestStatus{manifestStatusArchived, manifestStatusAlreadyMerged, manifestStatusSkipped}
+	for i, entry := range sealed.Files {
+		if entry.Status != want[i] {
+			t.Errorf("entry %d status = %q, want %q", i, entry.Status, want[i])
+		}
+	}
+}
+
+func TestLoadMergedHashesMissingArchDir(t *testing.T) {
+	dedup, err := loadMergedHashes(filepath.Join(t.TempDir(), "does-not-exist"), 5)
+	if err != nil {
+		t.Fatalf("loadMergedHashes: %v", err)
+	}
+	if len(dedup) != 0 {
+		t.Errorf("got %d hashes for a missing archive dir, want 0", len(dedup))
+	}
+}
+
+func TestWriteManifestCreatesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	m := &runManifest{Files: []fileManifestEntry{{Path: "a", Status: manifestStatusPending}}}
+	if err := writeManifest(path, m); err != nil {
+		t.Fatalf("writeManifest: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("manifest file not written: %v", err)
+	}
+}
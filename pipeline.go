@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// fileJob describes a single input CSV file waiting to be parsed.
+type fileJob struct {
+	path        string
+	ticker      string
+	size        int64
+	permutation []int
+}
+
+// fileBatch is the parsed, schema-remapped contents of one input file, ready
+// to be appended to the merged output.
+type fileBatch struct {
+	ticker string
+	rows   [][]string
+}
+
+// runPipeline walks datinDir and merges every CSV it finds into writer using
+// a pool of worker goroutines: one goroutine walks the tree and feeds jobs,
+// workers parse files concurrently, and a single writer goroutine owns the
+// csv.Writer so rows are never interleaved. Rows are remapped into schema's
+// merged column order before being written. If ordered is true, the writer
+// sorts batches by ticker before flushing so output is deterministic across
+// runs; otherwise rows are written in whatever order workers finish in.
+// The returned MergeReport's Warnings are populated even when the overall
+// error is nil, since a skipped file doesn't fail the run. An empty or
+// header-only file is not a warning: it's tallied in FilesEmpty instead,
+// since a quiet ticker is a normal occurrence and must not affect the run's
+// exit code. Files whose
+// content hash is already in dedupHashes (merged by a prior run) are
+// skipped without being read, and tracker is updated with every file's
+// final status so the sealed manifest reflects what actually happened.
+func runPipeline(ctx context.Context, datinDir string, writer *csv.Writer, workers int, ordered bool, schema *mergedSchema, dedupHashes map[string]bool, tracker *manifestTracker, stats *progressStats) (*MergeReport, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	jobs := make(chan fileJob)
+	results := make(chan fileBatch)
+	warnings := make(chan error)
+	empties := make(chan struct{})
+
+	g.Go(func() error {
+		defer close(jobs)
+		return filepath.Walk(datinDir, func(path string, info os.FileInfo, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".csv") {
+				return nil
+			}
+
+			perm, ok := schema.permutation[path]
+			if !ok {
+				// Header couldn't be read during schema reconciliation;
+				// already logged there.
+				return nil
+			}
+
+			if hash := tracker.hash(path); hash != "" && dedupHashes[hash] {
+				slog.Info("skipping duplicate file already merged in a prior run", "file", path, "sha256", hash)
+				// Record as already_merged rather than skipped: a plain
+				// "skipped" status isn't recognized by loadMergedHashes, so
+				// once the manifest that originally recorded this hash as
+				// merged ages out of the dedup window, the file would
+				// silently be re-merged. Carrying the already-merged status
+				// forward keeps the hash discoverable for as long as this
+				// file keeps showing up.
+				tracker.update(path, manifestStatusAlreadyMerged, 0)
+				return nil
+			}
+
+			atomic.AddInt64(&stats.FilesSeen, 1)
+			job := fileJob{
+				path:        path,
+				ticker:      strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())),
+				size:        info.Size(),
+				permutation: perm,
+			}
+			select {
+			case jobs <- job:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	})
+
+	var workerWG sync.WaitGroup
+	workerWG.Add(workers)
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			defer workerWG.Done()
+			for job := range jobs {
+				batch, err := parseFileJob(job, schema.null)
+				atomic.AddInt64(&stats.FilesDone, 1)
+				if err != nil {
+					tracker.update(job.path, manifestStatusSkipped, 0)
+					if errors.Is(err, ErrEmptyFile) {
+						// A quiet ticker is normal, not a failure: count it
+						// separately so it never trips the warnings-driven
+						// exit code.
+						select {
+						case empties <- struct{}{}:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+						continue
+					}
+					select {
+					case warnings <- err:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					continue
+				}
+				tracker.update(job.path, manifestStatusMerged, len(batch.rows))
+				atomic.AddInt64(&stats.BytesRead, job.size)
+				select {
+				case results <- batch:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+
+	go func() {
+		workerWG.Wait()
+		close(results)
+		close(warnings)
+		close(empties)
+	}()
+
+	report := &MergeReport{}
+
+	g.Go(func() error {
+		for err := range warnings {
+			report.Warnings = append(report.Warnings, err)
+			report.FilesSkipped++
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		for range empties {
+			report.FilesEmpty++
+		}
+		return nil
+	})
+
+	writeBatch := func(batch fileBatch) error {
+		if report.FilesProcessed == 0 {
+			if err := writer.Write(append(append([]string{}, schema.header...), "tick_nm")); err != nil {
+				return fmt.Errorf("failed to write header to output file: %w", err)
+			}
+		}
+		for _, row := range batch.rows {
+			if err := writer.Write(append(row, batch.ticker)); err != nil {
+				return fmt.Errorf("failed to write row to output file: %w", err)
+			}
+		}
+		atomic.AddInt64(&stats.RowsWritten, int64(len(batch.rows)))
+		report.FilesProcessed++
+		return nil
+	}
+
+	g.Go(func() error {
+		if !ordered {
+			for batch := range results {
+				if err := writeBatch(batch); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		var batches []fileBatch
+		for batch := range results {
+			batches = append(batches, batch)
+		}
+		sort.Slice(batches, func(i, j int) bool { return batches[i].ticker < batches[j].ticker })
+		for _, batch := range batches {
+			if err := writeBatch(batch); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// parseFileJob reads and parses a single input file, remapping each row into
+// the merged schema's column order. A non-nil error means the file was
+// skipped; it wraps one of the sentinel errors in errors.go so callers can
+// categorize it with errors.Is.
+func parseFileJob(job fileJob, null string) (fileBatch, error) {
+	slog.Info("processing file", "file", job.path, "ticker", job.ticker)
+
+	inF, err := os.Open(job.path)
+	if err != nil {
+		slog.Warn("could not open file, skipping", "file", job.path, "err", err)
+		return fileBatch{}, fmt.Errorf("%w: %s", ErrOpenFailed, job.path)
+	}
+	defer inF.Close()
+
+	reader := csv.NewReader(inF)
+	records, err := reader.ReadAll()
+	if err != nil {
+		slog.Warn("could not read CSV data, skipping", "file", job.path, "err", err)
+		return fileBatch{}, fmt.Errorf("%w: %s", ErrBadCSV, job.path)
+	}
+
+	if len(records) < 2 {
+		slog.Info("skipping empty or header-only file", "file", job.path)
+		return fileBatch{}, fmt.Errorf("%w: %s", ErrEmptyFile, job.path)
+	}
+
+	rows := make([][]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		rows = append(rows, remapRow(record, job.permutation, null))
+	}
+
+	return fileBatch{ticker: job.ticker, rows: rows}, nil
+}
+
+// remapRow reorders a raw CSV row into the merged schema's column order.
+// permutation[i] is the index of the merged column i within record, or -1
+// if record's file never had that column, in which case null is used.
+func remapRow(record []string, permutation []int, null string) []string {
+	out := make([]string, len(permutation))
+	for i, idx := range permutation {
+		if idx >= 0 && idx < len(record) {
+			out[i] = record[idx]
+		} else {
+			out[i] = null
+		}
+	}
+	return out
+}
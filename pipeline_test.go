@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestRunPipelineMixedGoodAndBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "close"}, {"2024-01-01", "1"}})
+	writeCSV(t, dir, "msft.csv", [][]string{{"date", "close"}, {"2024-01-01", "2"}})
+	// A malformed row (wrong field count) makes the CSV reader fail on this
+	// file without affecting the others.
+	writeCSV(t, dir, "bad.csv", [][]string{{"date", "close"}, {"2024-01-01", "3", "extra"}})
+
+	schema, err := buildSchema(dir, schemaModeStrict, "")
+	if err != nil {
+		t.Fatalf("buildSchema: %v", err)
+	}
+
+	manifest, err := buildManifest(dir)
+	if err != nil {
+		t.Fatalf("buildManifest: %v", err)
+	}
+	tracker := newManifestTracker(manifest)
+
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	stats := &progressStats{}
+
+	report, err := runPipeline(context.Background(), dir, writer, 2, true, schema, map[string]bool{}, tracker, stats)
+	writer.Flush()
+	if err != nil {
+		t.Fatalf("runPipeline: %v", err)
+	}
+
+	if report.FilesProcessed != 2 {
+		t.Errorf("FilesProcessed = %d, want 2", report.FilesProcessed)
+	}
+	if report.FilesSkipped != 1 {
+		t.Errorf("FilesSkipped = %d, want 1", report.FilesSkipped)
+	}
+	if len(report.Warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1", len(report.Warnings))
+	}
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	wantLines := []string{
+		"date,close,tick_nm",
+		"2024-01-01,1,aapl",
+		"2024-01-01,2,msft",
+	}
+	if len(lines) != len(wantLines) {
+		t.Fatalf("got %d output lines, want %d:\n%s", len(lines), len(wantLines), out.String())
+	}
+	for i, want := range wantLines {
+		if lines[i] != want {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressStats holds the counters the progress reporter repaints from.
+// Fields are updated with atomic operations since workers, the writer, and
+// the reporter goroutine all touch them concurrently.
+type progressStats struct {
+	FilesSeen   int64
+	FilesDone   int64
+	RowsWritten int64
+	BytesRead   int64
+}
+
+// rateSample is one (time, rows) observation used to compute a sliding
+// rows/sec rate for the ETA estimate.
+type rateSample struct {
+	at   time.Time
+	rows int64
+}
+
+const rateWindow = 2 * time.Second
+
+// reportProgress repaints a single status line with throughput and ETA until
+// done is closed. On a TTY it repaints in place every 100ms; otherwise (e.g.
+// output redirected to a file) it falls back to periodic log lines so the
+// log doesn't fill with carriage returns.
+func reportProgress(ctx context.Context, stats *progressStats, totalFiles int, done <-chan struct{}) {
+	interactive := term.IsTerminal(int(os.Stdout.Fd()))
+
+	interval := 100 * time.Millisecond
+	if !interactive {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var window []rateSample
+
+	print := func(final bool) {
+		filesDone := atomic.LoadInt64(&stats.FilesDone)
+		rows := atomic.LoadInt64(&stats.RowsWritten)
+		bytesRead := atomic.LoadInt64(&stats.BytesRead)
+
+		now := time.Now()
+		window = append(window, rateSample{now, rows})
+		cutoff := now.Add(-rateWindow)
+		for len(window) > 1 && window[0].at.Before(cutoff) {
+			window = window[1:]
+		}
+
+		var rowsPerSec float64
+		if elapsed := window[len(window)-1].at.Sub(window[0].at).Seconds(); elapsed > 0 {
+			rowsPerSec = float64(window[len(window)-1].rows-window[0].rows) / elapsed
+		}
+
+		eta := etaString(filesDone, int64(totalFiles), rows, rowsPerSec)
+		line := fmt.Sprintf("files %d/%d  rows %d  %s read  %.0f rows/s  eta %s",
+			filesDone, totalFiles, rows, formatBytes(bytesRead), rowsPerSec, eta)
+
+		switch {
+		case interactive && !final:
+			fmt.Fprintf(os.Stdout, "\r%s", line)
+		case interactive && final:
+			fmt.Fprintf(os.Stdout, "\r%s\n", line)
+		default:
+			slog.Info("progress", "files", filesDone, "totalFiles", totalFiles, "rows", rows, "bytesRead", bytesRead, "rowsPerSec", rowsPerSec, "eta", eta)
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			print(false)
+		case <-done:
+			print(true)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// etaString estimates remaining time from the average rows-per-file seen so
+// far and the current rows/sec rate.
+func etaString(filesDone, totalFiles, rows int64, rowsPerSec float64) string {
+	if totalFiles == 0 || filesDone >= totalFiles {
+		return "0s"
+	}
+	if filesDone == 0 || rowsPerSec <= 0 {
+		return "calculating"
+	}
+
+	avgRowsPerFile := float64(rows) / float64(filesDone)
+	remainingRows := avgRowsPerFile * float64(totalFiles-filesDone)
+	return time.Duration(remainingRows / rowsPerSec * float64(time.Second)).Round(time.Second).String()
+}
+
+// formatBytes renders a byte count using binary (KiB/MiB/...) units.
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,20 @@
+package main
+
+import "errors"
+
+// MergeReport summarizes the outcome of a processFiles run. FilesEmpty is
+// tracked separately from FilesSkipped/Warnings: an empty or header-only
+// file is a normal occurrence (e.g. a quiet ticker), not a failure, and must
+// not affect the run's exit code the way a real open/parse failure does.
+type MergeReport struct {
+	FilesProcessed int
+	FilesSkipped   int
+	FilesEmpty     int
+	Warnings       []error
+}
+
+// Err joins every warning into a single error so callers can test for a
+// specific failure category with errors.Is.
+func (r *MergeReport) Err() error {
+	return errors.Join(r.Warnings...)
+}
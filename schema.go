@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// schemaMode controls how differing CSV headers across input files are
+// reconciled before rows are merged.
+type schemaMode string
+
+const (
+	schemaModeStrict    schemaMode = "strict"
+	schemaModeUnion     schemaMode = "union"
+	schemaModeIntersect schemaMode = "intersect"
+)
+
+// parseSchemaMode validates a -schema flag value.
+func parseSchemaMode(s string) (schemaMode, error) {
+	switch schemaMode(s) {
+	case schemaModeStrict, schemaModeUnion, schemaModeIntersect:
+		return schemaMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown schema mode %q (want strict, union, or intersect)", s)
+	}
+}
+
+// mergedSchema is the reconciled column layout for a merge run: a single
+// header shared by every output row, plus a per-file permutation mapping
+// each merged column to the matching column index in that file's rows (or
+// -1 if the file doesn't have that column).
+type mergedSchema struct {
+	header      []string
+	permutation map[string][]int
+	null        string
+}
+
+// buildSchema makes a first pass over datinDir, reading only the header row
+// of each CSV file, and reconciles those headers into a single mergedSchema
+// according to mode. Files whose header can't be read are logged and
+// excluded from the returned permutation map, which means they'll also be
+// skipped by the merge pass.
+func buildSchema(datinDir string, mode schemaMode, null string) (*mergedSchema, error) {
+	paths, err := listCSVFiles(datinDir)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string][]string, len(paths))
+	var orderedPaths []string
+	for _, path := range paths {
+		header, err := readCSVHeader(path)
+		if err != nil {
+			slog.Warn("could not read header, skipping", "file", path, "err", err)
+			continue
+		}
+		headers[path] = header
+		orderedPaths = append(orderedPaths, path)
+	}
+
+	var merged []string
+	switch mode {
+	case schemaModeStrict:
+		merged, err = reconcileStrict(orderedPaths, headers)
+	case schemaModeUnion:
+		merged = reconcileUnion(orderedPaths, headers)
+	case schemaModeIntersect:
+		merged = reconcileIntersect(orderedPaths, headers)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	permutation := make(map[string][]int, len(orderedPaths))
+	for _, path := range orderedPaths {
+		perm := make([]int, len(merged))
+		fileCols := make(map[string]int, len(headers[path]))
+		for i, col := range headers[path] {
+			fileCols[col] = i
+		}
+		for i, col := range merged {
+			if idx, ok := fileCols[col]; ok {
+				perm[i] = idx
+			} else {
+				perm[i] = -1
+			}
+		}
+		permutation[path] = perm
+	}
+
+	return &mergedSchema{header: merged, permutation: permutation, null: null}, nil
+}
+
+// listCSVFiles returns every .csv file under datinDir in filepath.Walk's
+// (lexical, deterministic) order.
+func listCSVFiles(datinDir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(datinDir, func(path string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".csv") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// readCSVHeader reads just the first record of a CSV file.
+func readCSVHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	return reader.Read()
+}
+
+// reconcileStrict requires every file to share the first file's exact header
+// order, failing loudly on the first mismatch it finds.
+func reconcileStrict(paths []string, headers map[string][]string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	want := headers[paths[0]]
+	for _, path := range paths[1:] {
+		got := headers[path]
+		if !equalHeaders(want, got) {
+			return nil, fmt.Errorf("header mismatch in %s: expected %v, got %v", path, want, got)
+		}
+	}
+	return want, nil
+}
+
+// reconcileUnion computes the union of all headers, preserving first-seen
+// column order across files.
+func reconcileUnion(paths []string, headers map[string][]string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		for _, col := range headers[path] {
+			if !seen[col] {
+				seen[col] = true
+				merged = append(merged, col)
+			}
+		}
+	}
+	return merged
+}
+
+// reconcileIntersect keeps only the columns present in every file, in the
+// order they appear in the first file.
+func reconcileIntersect(paths []string, headers map[string][]string) []string {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, path := range paths {
+		for _, col := range headers[path] {
+			counts[col]++
+		}
+	}
+
+	var merged []string
+	for _, col := range headers[paths[0]] {
+		if counts[col] == len(paths) {
+			merged = append(merged, col)
+		}
+	}
+	return merged
+}
+
+func equalHeaders(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
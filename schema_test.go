@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeCSV writes a CSV file with the given rows (including the header row)
+// under dir and returns its path.
+func writeCSV(t *testing.T, dir, name string, rows [][]string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	var buf string
+	for _, row := range rows {
+		for i, cell := range row {
+			if i > 0 {
+				buf += ","
+			}
+			buf += cell
+		}
+		buf += "\n"
+	}
+	if err := os.WriteFile(path, []byte(buf), 0644); err != nil {
+		t.Fatalf("writeCSV(%s): %v", name, err)
+	}
+	return path
+}
+
+func TestBuildSchemaStrictMatchingHeaders(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "1", "2"}})
+	writeCSV(t, dir, "msft.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "3", "4"}})
+
+	schema, err := buildSchema(dir, schemaModeStrict, "")
+	if err != nil {
+		t.Fatalf("buildSchema: %v", err)
+	}
+	want := []string{"date", "open", "close"}
+	if !reflect.DeepEqual(schema.header, want) {
+		t.Errorf("header = %v, want %v", schema.header, want)
+	}
+	if len(schema.permutation) != 2 {
+		t.Errorf("permutation has %d entries, want 2", len(schema.permutation))
+	}
+}
+
+func TestBuildSchemaStrictMismatchErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "1", "2"}})
+	writeCSV(t, dir, "msft.csv", [][]string{{"date", "open", "high"}, {"2024-01-01", "3", "4"}})
+
+	if _, err := buildSchema(dir, schemaModeStrict, ""); err == nil {
+		t.Fatal("buildSchema: expected error on header mismatch, got nil")
+	}
+}
+
+func TestBuildSchemaUnionDriftingHeaders(t *testing.T) {
+	dir := t.TempDir()
+	aapl := writeCSV(t, dir, "aapl.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "1", "2"}})
+	msft := writeCSV(t, dir, "msft.csv", [][]string{{"date", "close", "volume"}, {"2024-01-01", "4", "1000"}})
+
+	schema, err := buildSchema(dir, schemaModeUnion, "NA")
+	if err != nil {
+		t.Fatalf("buildSchema: %v", err)
+	}
+	want := []string{"date", "open", "close", "volume"}
+	if !reflect.DeepEqual(schema.header, want) {
+		t.Errorf("header = %v, want %v", schema.header, want)
+	}
+
+	aaplPerm := schema.permutation[aapl]
+	wantAapl := []int{0, 1, 2, -1}
+	if !reflect.DeepEqual(aaplPerm, wantAapl) {
+		t.Errorf("aapl permutation = %v, want %v", aaplPerm, wantAapl)
+	}
+
+	msftPerm := schema.permutation[msft]
+	wantMsft := []int{0, -1, 1, 2}
+	if !reflect.DeepEqual(msftPerm, wantMsft) {
+		t.Errorf("msft permutation = %v, want %v", msftPerm, wantMsft)
+	}
+}
+
+func TestBuildSchemaIntersectDriftingHeaders(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "1", "2"}})
+	writeCSV(t, dir, "msft.csv", [][]string{{"date", "close", "volume"}, {"2024-01-01", "4", "1000"}})
+
+	schema, err := buildSchema(dir, schemaModeIntersect, "")
+	if err != nil {
+		t.Fatalf("buildSchema: %v", err)
+	}
+	want := []string{"date", "close"}
+	if !reflect.DeepEqual(schema.header, want) {
+		t.Errorf("header = %v, want %v", schema.header, want)
+	}
+}
+
+func TestBuildSchemaSkipsUnreadableHeader(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "aapl.csv", [][]string{{"date", "open", "close"}, {"2024-01-01", "1", "2"}})
+	// An empty file has no header row and should be skipped, not fail the run.
+	writeCSV(t, dir, "empty.csv", nil)
+
+	schema, err := buildSchema(dir, schemaModeStrict, "")
+	if err != nil {
+		t.Fatalf("buildSchema: %v", err)
+	}
+	if len(schema.permutation) != 1 {
+		t.Errorf("permutation has %d entries, want 1 (unreadable file excluded)", len(schema.permutation))
+	}
+}